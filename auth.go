@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionName    = "platify_session"
+	sessionUserKey = "user"
+	sessionCSRFKey = "csrf"
+)
+
+// sessionMaxAge is how long an authenticated session cookie lasts before the
+// browser drops it and the user has to log in again.
+const sessionMaxAge = 30 * 24 * 60 * 60 // 30 days, in seconds
+
+// newSessionStore builds the cookie-backed session store used to gate the
+// recipe editor and image upload endpoints. cfg.Auth.SessionSecret must be
+// set; see Config.validate. Options are set explicitly rather than relying
+// on gorilla/sessions' defaults: HttpOnly keeps the cookie out of reach of
+// any XSS, and Secure only applies in release mode so the documented dev
+// setup (plain http://localhost) still lets the cookie persist.
+func newSessionStore(cfg *Config) sessions.Store {
+	store := cookie.NewStore([]byte(cfg.Auth.SessionSecret))
+	store.Options(sessions.Options{
+		Path:     "/",
+		MaxAge:   sessionMaxAge,
+		HttpOnly: true,
+		Secure:   cfg.Mode == "release",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return store
+}
+
+// handleLoginPage renders the login form.
+// GET /login
+func handleLoginPage(c *gin.Context) {
+	c.HTML(http.StatusOK, "login", gin.H{"Next": c.Query("next")})
+}
+
+// handleLogin checks the submitted password against the configured admin
+// password and, on success, marks the session authenticated.
+// POST /login
+func handleLogin(c *gin.Context) {
+	password := c.PostForm("password")
+	next := c.PostForm("next")
+
+	if subtle.ConstantTimeCompare([]byte(password), []byte(appConfig.Auth.AdminPassword)) != 1 {
+		c.HTML(http.StatusUnauthorized, "login", gin.H{"Next": next, "Error": "Incorrect password"})
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set(sessionUserKey, "admin")
+	if err := session.Save(); err != nil {
+		renderError(c, http.StatusInternalServerError, "Login failed", "Could not start a session. Please try again.")
+		return
+	}
+
+	if !isLocalRedirect(next) {
+		next = "/recipes/editor"
+	}
+	c.Redirect(http.StatusFound, next)
+}
+
+// handleLogout clears the session.
+// POST /logout
+func handleLogout(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Clear()
+	_ = session.Save()
+	c.Redirect(http.StatusFound, "/")
+}
+
+// requireAuth gates a route behind an authenticated session. Requests that
+// prefer JSON (see wantsJSON) get a 401 JSON body; everything else is
+// redirected to /login?next=<original path>.
+func requireAuth(c *gin.Context) {
+	session := sessions.Default(c)
+	if session.Get(sessionUserKey) != nil {
+		c.Next()
+		return
+	}
+
+	if wantsJSON(c) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	c.Redirect(http.StatusFound, "/login?next="+c.Request.URL.Path)
+	c.Abort()
+}
+
+// isLocalRedirect reports whether next is safe to pass to c.Redirect: a
+// path on this site, not a scheme- or protocol-relative URL that would send
+// the browser somewhere else (e.g. "//evil.com" or "https://evil.com").
+func isLocalRedirect(next string) bool {
+	if next == "" || !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		return false
+	}
+	u, err := url.Parse(next)
+	return err == nil && u.Host == ""
+}
+
+// wantsJSON reports whether the request prefers a JSON response, used to
+// decide between a redirect and a 401 body.
+func wantsJSON(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "application/json")
+}
+
+// csrfToken returns the current session's CSRF token, generating and
+// persisting one on first use. The editor template renders it into a
+// hidden field/meta tag so client JS can send it back as X-CSRF-Token.
+func csrfToken(c *gin.Context) (string, error) {
+	session := sessions.Default(c)
+	if tok, ok := session.Get(sessionCSRFKey).(string); ok && tok != "" {
+		return tok, nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	tok := base64.RawURLEncoding.EncodeToString(buf)
+
+	session.Set(sessionCSRFKey, tok)
+	if err := session.Save(); err != nil {
+		return "", err
+	}
+	return tok, nil
+}
+
+// requireCSRF validates the X-CSRF-Token header against the session's
+// token. It must run after requireAuth so a session (and therefore a
+// token) exists.
+func requireCSRF(c *gin.Context) {
+	session := sessions.Default(c)
+	want, _ := session.Get(sessionCSRFKey).(string)
+	got := c.GetHeader("X-CSRF-Token")
+
+	if want == "" || subtle.ConstantTimeCompare([]byte(want), []byte(got)) != 1 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid or missing CSRF token"})
+		return
+	}
+	c.Next()
+}
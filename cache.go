@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+// upstreamMeta carries the validators the upstream API returned, so a
+// refresh can be sent as a conditional request.
+type upstreamMeta struct {
+	ETag         string
+	LastModified string
+}
+
+// cacheEntry holds one cached item. value is nil for a negative (404)
+// entry.
+type cacheEntry[T any] struct {
+	value     *T
+	meta      upstreamMeta
+	fetchedAt time.Time
+}
+
+// upstreamFetch fetches id from the upstream API, conditional on prevMeta if
+// it's non-zero. notModified is true when the upstream answered 304, in
+// which case value is nil and the caller should keep its existing entry.
+type upstreamFetch[T any] func(ctx context.Context, id string, prevMeta upstreamMeta) (value *T, meta upstreamMeta, notModified bool, err error)
+
+// CacheMetrics are the counters surfaced by handleMetrics.
+type CacheMetrics struct {
+	Hits           atomic.Int64
+	Misses         atomic.Int64
+	StaleServes    atomic.Int64
+	UpstreamErrors atomic.Int64
+}
+
+// Cache is a singleflight-deduplicated, stale-while-revalidate cache for a
+// single upstream resource type, keyed by ID. Data is served straight from
+// memory while "fresh"; once stale but within the longer window it's still
+// served immediately while a background refresh runs; beyond that window a
+// request blocks on a synchronous upstream fetch. 404s use negativeTTL
+// instead and never get a stale-while-revalidate window, so a bad ID stops
+// hammering the upstream without staying "missing" for long.
+type Cache[T any] struct {
+	name           string
+	fetch          upstreamFetch[T]
+	freshTTL       time.Duration
+	staleTTL       time.Duration
+	negativeTTL    time.Duration
+	refreshTimeout time.Duration
+	mu             sync.Mutex
+	entries        map[string]*cacheEntry[T]
+	group          singleflight.Group
+	metrics        CacheMetrics
+}
+
+func newCache[T any](name string, cfg *Config, fetch upstreamFetch[T]) *Cache[T] {
+	return &Cache[T]{
+		name:           name,
+		fetch:          fetch,
+		freshTTL:       time.Duration(cfg.Cache.FreshTTL),
+		staleTTL:       time.Duration(cfg.Cache.StaleTTL),
+		negativeTTL:    time.Duration(cfg.Cache.NegativeTTL),
+		refreshTimeout: time.Duration(cfg.Upstream.Timeout),
+		entries:        make(map[string]*cacheEntry[T]),
+	}
+}
+
+func (c *Cache[T]) isFresh(e *cacheEntry[T], now time.Time) bool {
+	ttl := c.freshTTL
+	if e.value == nil {
+		ttl = c.negativeTTL
+	}
+	return now.Sub(e.fetchedAt) < ttl
+}
+
+func (c *Cache[T]) isStale(e *cacheEntry[T], now time.Time) bool {
+	if e.value == nil {
+		return false // negative entries don't get a stale-while-revalidate window
+	}
+	return now.Sub(e.fetchedAt) < c.staleTTL
+}
+
+// Get returns the cached value for id, fetching or revalidating upstream as
+// needed. A nil value with a nil error means the upstream has no such
+// resource.
+func (c *Cache[T]) Get(ctx context.Context, id string) (*T, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[id]
+	c.mu.Unlock()
+
+	if ok && c.isFresh(entry, now) {
+		c.metrics.Hits.Add(1)
+		return entry.value, nil
+	}
+
+	if ok && c.isStale(entry, now) {
+		c.metrics.StaleServes.Add(1)
+		c.refreshInBackground(id)
+		return entry.value, nil
+	}
+
+	c.metrics.Misses.Add(1)
+	return c.fetchAndStore(ctx, id)
+}
+
+// refreshInBackground kicks off (or joins) a singleflight refresh for id
+// without waiting for it, used for stale-while-revalidate.
+func (c *Cache[T]) refreshInBackground(id string) {
+	go func() {
+		// A background refresh shouldn't be bound to any one request's
+		// lifetime, nor run forever against a wedged upstream.
+		ctx, cancel := context.WithTimeout(context.Background(), c.refreshTimeout)
+		defer cancel()
+		// fetchAndStore already counts any upstream error.
+		_, _ = c.fetchAndStore(ctx, id)
+	}()
+}
+
+func (c *Cache[T]) fetchAndStore(ctx context.Context, id string) (*T, error) {
+	result, err, _ := c.group.Do(id, func() (any, error) {
+		c.mu.Lock()
+		prev, hadPrev := c.entries[id]
+		c.mu.Unlock()
+
+		var prevMeta upstreamMeta
+		if hadPrev {
+			prevMeta = prev.meta
+		}
+
+		value, meta, notModified, err := c.fetch(ctx, id, prevMeta)
+		if err != nil {
+			c.metrics.UpstreamErrors.Add(1)
+			return nil, err
+		}
+
+		if notModified && hadPrev {
+			refreshed := &cacheEntry[T]{value: prev.value, meta: prev.meta, fetchedAt: time.Now()}
+			c.mu.Lock()
+			c.entries[id] = refreshed
+			c.mu.Unlock()
+			return refreshed.value, nil
+		}
+
+		entry := &cacheEntry[T]{value: value, meta: meta, fetchedAt: time.Now()}
+		c.mu.Lock()
+		c.entries[id] = entry
+		c.mu.Unlock()
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, nil
+	}
+	return result.(*T), nil
+}
+
+// recipeCache and productCache are initialized in main once the config has
+// been loaded, since their TTLs come from it.
+var (
+	recipeCache  *Cache[Recipe]
+	productCache *Cache[Product]
+)
+
+// handleHealthz reports basic liveness; it doesn't check upstream
+// reachability since a degraded upstream shouldn't take the site itself out
+// of a load balancer's rotation (see handleMetrics for that signal).
+func handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleMetrics exposes cache hit/miss/stale/error counters in the usual
+// Prometheus text exposition format, so operators can tell when the
+// upstream is degraded without digging through logs.
+func handleMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(c.Writer, "platify_cache_hits_total{cache=%q} %d\n", "recipe", recipeCache.metrics.Hits.Load())
+	fmt.Fprintf(c.Writer, "platify_cache_misses_total{cache=%q} %d\n", "recipe", recipeCache.metrics.Misses.Load())
+	fmt.Fprintf(c.Writer, "platify_cache_stale_serves_total{cache=%q} %d\n", "recipe", recipeCache.metrics.StaleServes.Load())
+	fmt.Fprintf(c.Writer, "platify_cache_upstream_errors_total{cache=%q} %d\n", "recipe", recipeCache.metrics.UpstreamErrors.Load())
+	fmt.Fprintf(c.Writer, "platify_cache_hits_total{cache=%q} %d\n", "product", productCache.metrics.Hits.Load())
+	fmt.Fprintf(c.Writer, "platify_cache_misses_total{cache=%q} %d\n", "product", productCache.metrics.Misses.Load())
+	fmt.Fprintf(c.Writer, "platify_cache_stale_serves_total{cache=%q} %d\n", "product", productCache.metrics.StaleServes.Load())
+	fmt.Fprintf(c.Writer, "platify_cache_upstream_errors_total{cache=%q} %d\n", "product", productCache.metrics.UpstreamErrors.Load())
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configSearchPaths, in priority order, are where loadConfig looks for
+// config.yaml when PLATIFY_CONFIG isn't set.
+var configSearchPaths = []string{"config.yaml", "/etc/platify/config.yaml"}
+
+// Duration wraps time.Duration so it can be written as "10s"/"5m"/"1h" in
+// config.yaml instead of a raw nanosecond count.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(any) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config is the single source of truth for runtime settings. It's loaded by
+// loadConfig from config.yaml (searched in ./, /etc/platify/, or a path from
+// PLATIFY_CONFIG), with env-var overrides layered on top for 12-factor
+// deployments.
+type Config struct {
+	Listen string `yaml:"listen"`
+	Mode   string `yaml:"mode"` // "dev" or "release"; dev also registers the _example preview routes
+
+	Upstream struct {
+		BaseURL string   `yaml:"baseUrl"`
+		Timeout Duration `yaml:"timeout"`
+		APIKey  string   `yaml:"apiKey"` // sent as "Authorization: Bearer <APIKey>" on POST/PUT /recipes; leave empty if the upstream doesn't require it
+	} `yaml:"upstream"`
+
+	Upload struct {
+		MaxSizeBytes     int64    `yaml:"maxSizeBytes"`
+		AllowedMIMETypes []string `yaml:"allowedMimeTypes"`
+	} `yaml:"upload"`
+
+	Storage struct {
+		Backend string `yaml:"backend"` // "local", "bunny" or "s3"
+		Local   struct {
+			Dir string `yaml:"dir"`
+		} `yaml:"local"`
+		Bunny struct {
+			StorageEndpoint string `yaml:"storageEndpoint"`
+			CDNBaseURL      string `yaml:"cdnBaseUrl"`
+			AccessKey       string `yaml:"accessKey"`
+		} `yaml:"bunny"`
+	} `yaml:"storage"`
+
+	Cache struct {
+		FreshTTL    Duration `yaml:"freshTtl"`
+		StaleTTL    Duration `yaml:"staleTtl"`
+		NegativeTTL Duration `yaml:"negativeTtl"`
+	} `yaml:"cache"`
+
+	Auth struct {
+		SessionSecret string `yaml:"sessionSecret"` // signs/encrypts the session cookie; keep this out of version control
+		AdminPassword string `yaml:"adminPassword"` // shared password gating the editor and image upload endpoints
+	} `yaml:"auth"`
+
+	Recipes struct {
+		AllowedImageHosts []string `yaml:"allowedImageHosts"` // hosts, besides our own /static/uploads/, a Recipe.Image may point at
+	} `yaml:"recipes"`
+}
+
+// defaultConfig mirrors the values this server used before config.yaml
+// existed. auth.sessionSecret and auth.adminPassword have no default, so an
+// empty/absent config file only passes validate when those two are supplied
+// via SESSION_SECRET and ADMIN_PASSWORD.
+func defaultConfig() *Config {
+	cfg := &Config{
+		Listen: ":8080",
+		Mode:   "dev",
+	}
+	cfg.Upstream.BaseURL = "https://platify.aukespot.com/"
+	cfg.Upstream.Timeout = Duration(10 * time.Second)
+	cfg.Upload.MaxSizeBytes = 10 << 20 // 10 MB
+	cfg.Upload.AllowedMIMETypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+	cfg.Storage.Backend = "local"
+	cfg.Storage.Local.Dir = "static/uploads"
+	cfg.Cache.FreshTTL = Duration(5 * time.Minute)
+	cfg.Cache.StaleTTL = Duration(1 * time.Hour)
+	cfg.Cache.NegativeTTL = Duration(30 * time.Second)
+	return cfg
+}
+
+// loadConfig finds and parses config.yaml (if any), applies env-var
+// overrides, and validates the result. It fails fast with every
+// missing/invalid field listed at once, rather than stopping at the first
+// one.
+func loadConfig() (*Config, error) {
+	cfg := defaultConfig()
+
+	path, err := findConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+
+	applyConfigEnvOverrides(cfg)
+
+	if errs := cfg.validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  - %s", strings.Join(errs, "\n  - "))
+	}
+	return cfg, nil
+}
+
+func findConfigFile() (string, error) {
+	if p := os.Getenv("PLATIFY_CONFIG"); p != "" {
+		if _, err := os.Stat(p); err != nil {
+			return "", fmt.Errorf("PLATIFY_CONFIG=%s: %w", p, err)
+		}
+		return p, nil
+	}
+	for _, p := range configSearchPaths {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", nil // no config file is fine; defaults + env overrides still apply
+}
+
+// applyConfigEnvOverrides layers env vars on top of whatever config.yaml
+// set. PORT and API_BASE_URL keep working as before; SESSION_SECRET and
+// ADMIN_PASSWORD (or their config.yaml fields) must now also be set, since
+// validate requires them.
+func applyConfigEnvOverrides(cfg *Config) {
+	if v := os.Getenv("PORT"); v != "" {
+		cfg.Listen = ":" + v
+	}
+	if v := os.Getenv("API_BASE_URL"); v != "" {
+		cfg.Upstream.BaseURL = v
+	}
+	if v := os.Getenv("PLATIFY_MODE"); v != "" {
+		cfg.Mode = v
+	} else if os.Getenv("GIN_MODE") == "release" {
+		cfg.Mode = "release"
+	}
+	if v := os.Getenv("STORAGE"); v != "" {
+		cfg.Storage.Backend = v
+	}
+	if v := os.Getenv("BUNNY_STORAGE_ENDPOINT"); v != "" {
+		cfg.Storage.Bunny.StorageEndpoint = v
+	}
+	if v := os.Getenv("BUNNY_CDN_BASE_URL"); v != "" {
+		cfg.Storage.Bunny.CDNBaseURL = v
+	}
+	if v := os.Getenv("BUNNY_ACCESS_KEY"); v != "" {
+		cfg.Storage.Bunny.AccessKey = v
+	}
+	if v := os.Getenv("SESSION_SECRET"); v != "" {
+		cfg.Auth.SessionSecret = v
+	}
+	if v := os.Getenv("ADMIN_PASSWORD"); v != "" {
+		cfg.Auth.AdminPassword = v
+	}
+	if v := os.Getenv("UPSTREAM_API_KEY"); v != "" {
+		cfg.Upstream.APIKey = v
+	}
+}
+
+// validate returns every problem with cfg, rather than the first one, so a
+// misconfigured deployment can be fixed in one pass.
+func (c *Config) validate() []string {
+	var errs []string
+
+	if c.Listen == "" || !strings.Contains(c.Listen, ":") {
+		errs = append(errs, fmt.Sprintf("listen: %q must be a host:port or :port address", c.Listen))
+	}
+	if c.Mode != "dev" && c.Mode != "release" {
+		errs = append(errs, fmt.Sprintf("mode: %q must be \"dev\" or \"release\"", c.Mode))
+	}
+	if c.Upstream.BaseURL == "" {
+		errs = append(errs, "upstream.baseUrl: must not be empty")
+	}
+	if c.Upstream.Timeout <= 0 {
+		errs = append(errs, "upstream.timeout: must be positive")
+	}
+	if c.Upload.MaxSizeBytes <= 0 {
+		errs = append(errs, "upload.maxSizeBytes: must be positive")
+	}
+	if len(c.Upload.AllowedMIMETypes) == 0 {
+		errs = append(errs, "upload.allowedMimeTypes: must list at least one MIME type")
+	}
+
+	switch c.Storage.Backend {
+	case "local":
+		if c.Storage.Local.Dir == "" {
+			errs = append(errs, "storage.local.dir: must not be empty")
+		}
+	case "bunny":
+		if c.Storage.Bunny.StorageEndpoint == "" {
+			errs = append(errs, "storage.bunny.storageEndpoint: must not be empty")
+		}
+		if c.Storage.Bunny.CDNBaseURL == "" {
+			errs = append(errs, "storage.bunny.cdnBaseUrl: must not be empty")
+		}
+		if c.Storage.Bunny.AccessKey == "" {
+			errs = append(errs, "storage.bunny.accessKey: must not be empty")
+		}
+	case "s3":
+		// Not implemented yet (see newStorage); nothing to validate.
+	default:
+		errs = append(errs, fmt.Sprintf("storage.backend: unknown backend %q", c.Storage.Backend))
+	}
+
+	if c.Cache.FreshTTL <= 0 {
+		errs = append(errs, "cache.freshTtl: must be positive")
+	}
+	if c.Cache.StaleTTL <= 0 {
+		errs = append(errs, "cache.staleTtl: must be positive")
+	}
+	if c.Cache.NegativeTTL <= 0 {
+		errs = append(errs, "cache.negativeTtl: must be positive")
+	}
+
+	if len(c.Auth.SessionSecret) < 16 {
+		errs = append(errs, "auth.sessionSecret: must be set to a random string of at least 16 bytes")
+	}
+	if c.Auth.AdminPassword == "" {
+		errs = append(errs, "auth.adminPassword: must not be empty")
+	}
+
+	return errs
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"strings"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp" // register WebP decoding for image.DecodeConfig/imaging.Decode
+)
+
+// maxImagePixels guards against decompression-bomb uploads: images whose
+// width*height exceeds this are rejected before any decoding work happens.
+const maxImagePixels = 40_000_000 // ~8000x5000
+
+// variantSizes are the max-dimension targets emitted by processImage, in
+// addition to the original. 0 means "the original size".
+var variantSizes = []int{320, 640, 1280, 0}
+
+var errImageTooLarge = errors.New("image exceeds the maximum allowed pixel count")
+
+// ImageVariant is one resized rendition of an uploaded image, stored as
+// both WebP (preferred) and JPEG (fallback for browsers without WebP
+// support) so the frontend can build a <picture>/srcset without another API
+// call, deriving each URL from the key it already has.
+type ImageVariant struct {
+	MaxDimension int    `json:"maxDimension"` // 0 for the original
+	WebPURL      string `json:"webpUrl"`
+	JPEGURL      string `json:"jpegUrl"`
+}
+
+// ProcessedImage is the result of running an upload through processImage.
+type ProcessedImage struct {
+	Width         int            `json:"width"`
+	Height        int            `json:"height"`
+	DominantColor string         `json:"dominantColor"` // "#rrggbb", for a CSS background-color placeholder
+	Variants      []ImageVariant `json:"variants"`
+}
+
+// processImage decodes an uploaded image, auto-orients it from the EXIF
+// Orientation tag and strips the rest of the EXIF data (re-encoding never
+// copies it across), then stores a WebP+JPEG pair for each entry in
+// variantSizes under "<keyPrefix>_<size>.webp" / ".jpg"
+// ("<keyPrefix>_orig.*" for the original).
+func processImage(ctx context.Context, raw []byte, storage Storage, keyPrefix string) (*ProcessedImage, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image header: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, errImageTooLarge
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(raw), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	bounds := img.Bounds()
+
+	result := &ProcessedImage{
+		Width:         bounds.Dx(),
+		Height:        bounds.Dy(),
+		DominantColor: dominantColorHex(img),
+	}
+
+	for _, size := range variantSizes {
+		variantImg := img
+		label := "orig"
+		switch {
+		case size > 0 && size < max(bounds.Dx(), bounds.Dy()):
+			variantImg = imaging.Fit(img, size, size, imaging.Lanczos)
+			label = fmt.Sprintf("%d", size)
+		case size > 0:
+			// Never upscale past the original.
+			continue
+		}
+
+		webpURL, err := encodeAndStore(ctx, storage, variantImg, keyPrefix+"_"+label+".webp", encodeWebP)
+		if err != nil {
+			return nil, err
+		}
+		jpegURL, err := encodeAndStore(ctx, storage, variantImg, keyPrefix+"_"+label+".jpg", encodeJPEG)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Variants = append(result.Variants, ImageVariant{
+			MaxDimension: size,
+			WebPURL:      webpURL,
+			JPEGURL:      jpegURL,
+		})
+	}
+
+	return result, nil
+}
+
+func encodeWebP(w io.Writer, img image.Image) error {
+	return webp.Encode(w, img, &webp.Options{Quality: 82})
+}
+
+func encodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 82})
+}
+
+func encodeAndStore(ctx context.Context, storage Storage, img image.Image, key string, encode func(io.Writer, image.Image) error) (string, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		return "", fmt.Errorf("encoding %s: %w", key, err)
+	}
+
+	contentType := "image/jpeg"
+	if strings.HasSuffix(key, ".webp") {
+		contentType = "image/webp"
+	}
+
+	url, err := storage.Put(ctx, key, contentType, &buf)
+	if err != nil {
+		return "", fmt.Errorf("storing %s: %w", key, err)
+	}
+	return url, nil
+}
+
+// dominantColorHex downsamples img to a single pixel and returns its color
+// as a "#rrggbb" string.
+func dominantColorHex(img image.Image) string {
+	avg := imaging.Resize(img, 1, 1, imaging.Box)
+	r, g, b, _ := avg.At(0, 0).RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
@@ -2,39 +2,30 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
-	"math/rand/v2"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
-// uploadsDir is where recipe images uploaded via the editor are persisted.
-const uploadsDir = "static/uploads"
+// imageStorage is the Storage backend selected at startup by newStorage;
+// handlers only ever talk to it through the interface.
+var imageStorage Storage
 
-// ─── Config ─────────────────────────────────────────────────────────────────
-
-func apiBase() string {
-	if v := os.Getenv("API_BASE_URL"); v != "" {
-		return strings.TrimRight(v, "/")
-	}
-	return "https://platify.aukespot.com/"
-}
-
-func listenAddr() string {
-	if v := os.Getenv("PORT"); v != "" {
-		return ":" + v
-	}
-	return ":8080"
-}
+// appConfig is the Config loaded by main at startup; see config.go.
+var appConfig *Config
 
 // ─── Data models ─────────────────────────────────────────────────────────────
 
@@ -171,68 +162,98 @@ func loadTemplates() *template.Template {
 
 // ─── API client ──────────────────────────────────────────────────────────────
 
-func fetchRecipe(id string) (*Recipe, error) {
-	url := apiBase() + "/recipes/" + id
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// fetchRecipeUpstream is the upstreamFetch backing recipeCache. When
+// prevMeta carries a validator from an earlier fetch it's sent as
+// If-None-Match/If-Modified-Since; a 304 is reported via notModified so the
+// cache can keep serving its existing entry.
+func fetchRecipeUpstream(ctx context.Context, id string, prevMeta upstreamMeta) (*Recipe, upstreamMeta, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(appConfig.Upstream.Timeout))
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := http.DefaultClient.Do(req)
+	url := strings.TrimRight(appConfig.Upstream.BaseURL, "/") + "/recipes/" + id
+	resp, err := doConditionalGet(ctx, url, prevMeta)
 	if err != nil {
-		return nil, err
+		return nil, upstreamMeta{}, false, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, upstreamMeta{}, true, nil
+	}
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, nil
+		return nil, upstreamMeta{}, false, nil
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+		return nil, upstreamMeta{}, false, fmt.Errorf("API returned status %d", resp.StatusCode)
 	}
 
 	var rr RecipeResponse
 	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
-		return nil, err
+		return nil, upstreamMeta{}, false, err
 	}
-	return &rr.Recipe, nil
+	return &rr.Recipe, metaFromResponse(resp), false, nil
 }
 
-func fetchProduct(id string) (*Product, error) {
-	url := apiBase() + "/products/" + id
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// fetchProductUpstream is the upstreamFetch backing productCache.
+func fetchProductUpstream(ctx context.Context, id string, prevMeta upstreamMeta) (*Product, upstreamMeta, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(appConfig.Upstream.Timeout))
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	url := strings.TrimRight(appConfig.Upstream.BaseURL, "/") + "/products/" + id
+	resp, err := doConditionalGet(ctx, url, prevMeta)
 	if err != nil {
-		return nil, err
-	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+		return nil, upstreamMeta{}, false, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, upstreamMeta{}, true, nil
+	}
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, nil
+		return nil, upstreamMeta{}, false, nil
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+		return nil, upstreamMeta{}, false, fmt.Errorf("API returned status %d", resp.StatusCode)
 	}
 
 	var product Product
 	if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
+		return nil, upstreamMeta{}, false, err
+	}
+	return &product, metaFromResponse(resp), false, nil
+}
+
+// doConditionalGet issues a GET against url, attaching If-None-Match /
+// If-Modified-Since from prevMeta when present. ctx governs the whole
+// round trip, including the caller's later read of resp.Body.
+func doConditionalGet(ctx context.Context, url string, prevMeta upstreamMeta) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
 		return nil, err
 	}
-	return &product, nil
+	if prevMeta.ETag != "" {
+		req.Header.Set("If-None-Match", prevMeta.ETag)
+	}
+	if prevMeta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", prevMeta.LastModified)
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+func metaFromResponse(resp *http.Response) upstreamMeta {
+	return upstreamMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
 }
 
 // ─── Handlers ────────────────────────────────────────────────────────────────
 
-// handleImageUpload accepts a multipart image upload, saves it under
-// static/uploads/, and returns the public URL as JSON.
+// handleImageUpload accepts a multipart image upload, runs it through
+// processImage (auto-orient, strip EXIF, generate size variants), and
+// returns the resulting dimensions, dominant color and variant URLs as
+// JSON.
 // POST /api/images/upload  (field name: "image")
 func handleImageUpload(c *gin.Context) {
 	file, err := c.FormFile("image")
@@ -241,7 +262,6 @@ func handleImageUpload(c *gin.Context) {
 		return
 	}
 
-	// Open and read the first 512 bytes to detect the actual content type.
 	src, err := file.Open()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read image"})
@@ -249,47 +269,61 @@ func handleImageUpload(c *gin.Context) {
 	}
 	defer src.Close()
 
-	header := make([]byte, 512)
-	n, err := src.Read(header)
-	if err != nil && err != io.EOF {
+	raw, err := io.ReadAll(src)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read image"})
 		return
 	}
-	ct := http.DetectContentType(header[:n])
 
-	extMap := map[string]string{
-		"image/jpeg": ".jpg",
-		"image/png":  ".png",
-		"image/gif":  ".gif",
-		"image/webp": ".webp",
-	}
-	ext, ok := extMap[ct]
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported image type; use JPEG, PNG, GIF or WebP"})
+	if int64(len(raw)) > appConfig.Upload.MaxSizeBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "image exceeds the maximum upload size"})
 		return
 	}
 
-	if err := os.MkdirAll(uploadsDir, 0o755); err != nil {
-		log.Printf("handleImageUpload: mkdir %s: %v", uploadsDir, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "storage error"})
+	ct := http.DetectContentType(raw)
+	if !slices.Contains(appConfig.Upload.AllowedMIMETypes, ct) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported image type; use JPEG, PNG, GIF or WebP"})
 		return
 	}
 
-	// Combine timestamp + random uint32 to avoid collisions under concurrency.
-	filename := fmt.Sprintf("%d_%08x%s", time.Now().UnixNano(), rand.Uint32(), ext)
-	dst := filepath.Join(uploadsDir, filename)
+	key := fmt.Sprintf("%x", sha256.Sum256(raw))[:16]
 
-	if err := c.SaveUploadedFile(file, dst); err != nil {
-		log.Printf("handleImageUpload: save %s: %v", dst, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save image"})
+	processed, err := processImage(c.Request.Context(), raw, imageStorage, key)
+	if err != nil {
+		if errors.Is(err, errImageTooLarge) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errImageTooLarge.Error()})
+			return
+		}
+		log.Printf("handleImageUpload: processImage(%s): %v", key, err)
+		var unavailable *storageUnavailableError
+		if errors.As(err, &unavailable) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "image storage is temporarily unavailable"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process image"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"url": "/static/uploads/" + filename})
+	c.JSON(http.StatusOK, gin.H{
+		"key":           key,
+		"width":         processed.Width,
+		"height":        processed.Height,
+		"dominantColor": processed.DominantColor,
+		"variants":      processed.Variants,
+	})
 }
 
+// handleRecipeEditor renders the editor, including a per-session CSRF token
+// the page must send back as X-CSRF-Token when it calls the upload/recipe
+// APIs. Gated behind requireAuth.
 func handleRecipeEditor(c *gin.Context) {
-	c.HTML(http.StatusOK, "recipe_editor", nil)
+	token, err := csrfToken(c)
+	if err != nil {
+		log.Printf("handleRecipeEditor: csrfToken: %v", err)
+		renderError(c, http.StatusInternalServerError, "Could not load editor", "Please try again later.")
+		return
+	}
+	c.HTML(http.StatusOK, "recipe_editor", gin.H{"CSRFToken": token})
 }
 
 func handleHome(c *gin.Context) {
@@ -298,46 +332,112 @@ func handleHome(c *gin.Context) {
 
 func handleRecipe(c *gin.Context) {
 	id := c.Param("id")
+	c.Header("Vary", "Accept")
 
-	recipe, err := fetchRecipe(id)
+	recipe, err := recipeCache.Get(c.Request.Context(), id)
 	if err != nil {
 		log.Printf("fetchRecipe(%q): %v", id, err)
+		if prefersJSON(c) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load recipe"})
+			return
+		}
 		renderError(c, http.StatusInternalServerError,
 			"Could not load recipe",
 			"The recipe could not be loaded. Please try again later.")
 		return
 	}
 	if recipe == nil {
+		if prefersJSON(c) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "recipe not found"})
+			return
+		}
 		renderError(c, http.StatusNotFound,
 			"Recipe not found",
 			"This recipe does not exist or is no longer available.")
 		return
 	}
 
+	if prefersJSON(c) {
+		writeJSONWithETag(c, recipe)
+		return
+	}
 	c.HTML(http.StatusOK, "recipe", recipe)
 }
 
 func handleProduct(c *gin.Context) {
 	id := c.Param("id")
+	c.Header("Vary", "Accept")
 
-	product, err := fetchProduct(id)
+	product, err := productCache.Get(c.Request.Context(), id)
 	if err != nil {
 		log.Printf("fetchProduct(%q): %v", id, err)
+		if prefersJSON(c) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load product"})
+			return
+		}
 		renderError(c, http.StatusInternalServerError,
 			"Could not load product",
 			"The product could not be loaded. Please try again later.")
 		return
 	}
 	if product == nil {
+		if prefersJSON(c) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return
+		}
 		renderError(c, http.StatusNotFound,
 			"Product not found",
 			"This product does not exist or is no longer available.")
 		return
 	}
 
+	if prefersJSON(c) {
+		writeJSONWithETag(c, product)
+		return
+	}
 	c.HTML(http.StatusOK, "product", product)
 }
 
+// ─── Content negotiation ─────────────────────────────────────────────────────
+
+// prefersJSON reports whether /recipes/:id or /products/:id should respond
+// with the raw JSON struct instead of rendering the HTML page. An explicit
+// ?format=json (or ?format=html) query param always wins, so links can force
+// one representation regardless of client headers; otherwise it falls back
+// to the Accept header.
+func prefersJSON(c *gin.Context) bool {
+	switch c.Query("format") {
+	case "json":
+		return true
+	case "html":
+		return false
+	}
+	return wantsJSON(c)
+}
+
+// writeJSONWithETag marshals payload, derives a stable ETag from a hash of
+// the marshalled bytes, and either answers 304 when it matches the
+// request's If-None-Match or writes the JSON body with that ETag attached.
+// This lets the editor and third-party integrations treat the site as a
+// thin, cacheable proxy in front of the upstream API.
+func writeJSONWithETag(c *gin.Context, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("writeJSONWithETag: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode response"})
+		return
+	}
+
+	etag := fmt.Sprintf("%q", fmt.Sprintf("%x", sha256.Sum256(body)))
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", body)
+}
+
 // handleExampleRecipe renders the recipe page using testdata/example_recipe.json.
 // Only registered in non-release mode (GIN_MODE != release).
 func handleExampleRecipe(c *gin.Context) {
@@ -384,29 +484,55 @@ func renderError(c *gin.Context, status int, title, message string) {
 // ─── Main ────────────────────────────────────────────────────────────────────
 
 func main() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	appConfig = cfg
+
+	if cfg.Mode == "release" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	storage, err := newStorage(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	imageStorage = storage
+
+	recipeCache = newCache[Recipe]("recipe", cfg, fetchRecipeUpstream)
+	productCache = newCache[Product]("product", cfg, fetchProductUpstream)
+
 	router := gin.Default()
-	router.MaxMultipartMemory = 10 << 20 // 10 MB max upload
+	router.MaxMultipartMemory = cfg.Upload.MaxSizeBytes
 	router.SetHTMLTemplate(loadTemplates())
 	router.Static("/static", "./static")
+	router.Use(sessions.Sessions(sessionName, newSessionStore(cfg)))
 
 	router.GET("/", handleHome)
-	router.GET("/recipes/editor", handleRecipeEditor)
+	router.GET("/login", handleLoginPage)
+	router.POST("/login", handleLogin)
+	router.POST("/logout", handleLogout)
+	router.GET("/recipes/editor", requireAuth, handleRecipeEditor)
 	router.GET("/recipes/:id", handleRecipe)
 	router.GET("/products/:id", handleProduct)
 	router.GET("/privacy-policy", handlePrivacyPolicy)
-	router.POST("/api/images/upload", handleImageUpload)
+	router.POST("/api/images/upload", requireAuth, requireCSRF, handleImageUpload)
+	router.POST("/api/recipes", requireAuth, requireCSRF, handleCreateRecipe)
+	router.PUT("/api/recipes/:id", requireAuth, requireCSRF, handleUpdateRecipe)
+	router.GET("/healthz", handleHealthz)
+	router.GET("/metrics", handleMetrics)
 
 	// Dev-only: preview the recipe/product pages with local example data.
-	if gin.Mode() != gin.ReleaseMode {
+	if cfg.Mode != "release" {
 		router.GET("/recipes/_example", handleExampleRecipe)
 		log.Printf("Dev route registered: GET /recipes/_example")
 		router.GET("/products/_example", handleExampleProduct)
 		log.Printf("Dev route registered: GET /products/_example")
 	}
 
-	addr := listenAddr()
-	log.Printf("Platify website listening on %s", addr)
-	if err := router.Run(addr); err != nil {
+	log.Printf("Platify website listening on %s", cfg.Listen)
+	if err := router.Run(cfg.Listen); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fieldError is one entry in the {errors: [...]} body returned to the editor
+// when a recipe fails validation, either locally or at the upstream API.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// handleCreateRecipe validates the posted Recipe and forwards it upstream as
+// a new recipe.
+// POST /api/recipes
+func handleCreateRecipe(c *gin.Context) {
+	handleRecipeWrite(c, http.MethodPost, strings.TrimRight(appConfig.Upstream.BaseURL, "/")+"/recipes")
+}
+
+// handleUpdateRecipe validates the posted Recipe and forwards it upstream as
+// an update to an existing recipe.
+// PUT /api/recipes/:id
+func handleUpdateRecipe(c *gin.Context) {
+	id := c.Param("id")
+	handleRecipeWrite(c, http.MethodPut, strings.TrimRight(appConfig.Upstream.BaseURL, "/")+"/recipes/"+id)
+}
+
+// handleRecipeWrite backs both handleCreateRecipe and handleUpdateRecipe:
+// decode the editor's Recipe JSON, validate it server-side, forward it
+// upstream, and translate the result (or the upstream's own validation
+// errors) back into the editor's {errors: [{field, message}]} shape. This is
+// what makes handleRecipeEditor functional end-to-end instead of a static
+// page.
+func handleRecipeWrite(c *gin.Context, method, upstreamURL string) {
+	var recipe Recipe
+	if err := c.ShouldBindJSON(&recipe); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"errors": []fieldError{{Message: "invalid JSON body"}}})
+		return
+	}
+
+	if errs := validateRecipe(recipe); len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"errors": errs})
+		return
+	}
+
+	id, errs, err := writeRecipeUpstream(c.Request.Context(), method, upstreamURL, recipe)
+	if err != nil {
+		log.Printf("handleRecipeWrite: %s %s: %v", method, upstreamURL, err)
+		c.JSON(http.StatusBadGateway, gin.H{"errors": []fieldError{{Message: "upstream API is temporarily unavailable"}}})
+		return
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"errors": errs})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "url": "/recipes/" + id})
+}
+
+// validateRecipe checks the fields handleRecipeWrite can't safely delegate to
+// the upstream API: a non-empty name, at least one section, ingredient
+// quantities that parse as numbers wherever a unit is given, and an image
+// URL that can't be used to smuggle an arbitrary fetch target into the
+// editor.
+func validateRecipe(r Recipe) []fieldError {
+	var errs []fieldError
+
+	if strings.TrimSpace(r.Name) == "" {
+		errs = append(errs, fieldError{Field: "name", Message: "must not be empty"})
+	}
+	if len(r.Sections) == 0 {
+		errs = append(errs, fieldError{Field: "sections", Message: "must include at least one section"})
+	}
+
+	for i, section := range r.Sections {
+		for j, ing := range section.Ingredients {
+			if ing.Unit == "" {
+				continue
+			}
+			if _, err := strconv.ParseFloat(strings.TrimSpace(ing.Quantity), 64); err != nil {
+				errs = append(errs, fieldError{
+					Field:   fmt.Sprintf("sections[%d].ingredients[%d].quantity", i, j),
+					Message: fmt.Sprintf("must be a number when a unit is given, got %q", ing.Quantity),
+				})
+			}
+		}
+	}
+
+	if r.Image != "" && !imageURLAllowed(r.Image) {
+		errs = append(errs, fieldError{
+			Field:   "image",
+			Message: "must be a path under /static/uploads/ or an https URL on an allow-listed host",
+		})
+	}
+
+	return errs
+}
+
+// imageURLAllowed reports whether raw is safe to store as a Recipe.Image:
+// either one of our own uploads, or an https URL on a host the operator has
+// explicitly allow-listed in config.
+func imageURLAllowed(raw string) bool {
+	if strings.HasPrefix(raw, "/static/uploads/") {
+		return true
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+	return slices.Contains(appConfig.Recipes.AllowedImageHosts, u.Host)
+}
+
+// upstreamWriteResponse is the body the upstream API returns on a successful
+// create/update.
+type upstreamWriteResponse struct {
+	ID string `json:"id"`
+}
+
+// upstreamErrorResponse is the body the upstream API returns on a 4xx, in
+// the same {errors: [{field, message}]} shape we hand back to the editor.
+type upstreamErrorResponse struct {
+	Errors []fieldError `json:"errors"`
+	Error  string       `json:"error"`
+}
+
+// writeRecipeUpstream POSTs/PUTs recipe to the upstream API and reports
+// either the assigned ID, the upstream's own field errors (for a 4xx), or an
+// error for anything else (network failure, 5xx) so the caller can surface
+// it as a 502.
+func writeRecipeUpstream(ctx context.Context, method, upstreamURL string, recipe Recipe) (id string, errs []fieldError, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(appConfig.Upstream.Timeout))
+	defer cancel()
+
+	body, err := json.Marshal(RecipeResponse{Recipe: recipe})
+	if err != nil {
+		return "", nil, fmt.Errorf("marshalling recipe: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, upstreamURL, bytes.NewReader(body))
+	if err != nil {
+		return "", nil, fmt.Errorf("building upstream request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if appConfig.Upstream.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+appConfig.Upstream.APIKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", nil, fmt.Errorf("reading upstream response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		var written upstreamWriteResponse
+		if err := json.Unmarshal(respBody, &written); err != nil {
+			return "", nil, fmt.Errorf("decoding upstream response: %w", err)
+		}
+		return written.ID, nil, nil
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError {
+		var upstreamErr upstreamErrorResponse
+		if err := json.Unmarshal(respBody, &upstreamErr); err == nil && len(upstreamErr.Errors) > 0 {
+			return "", upstreamErr.Errors, nil
+		}
+		msg := upstreamErr.Error
+		if msg == "" {
+			msg = fmt.Sprintf("upstream rejected the request (status %d)", resp.StatusCode)
+		}
+		return "", []fieldError{{Message: msg}}, nil
+	}
+
+	return "", nil, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+}
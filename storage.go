@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ─── Storage ─────────────────────────────────────────────────────────────────
+
+// Storage abstracts where uploaded recipe images are persisted, so
+// handleImageUpload doesn't need to know whether images end up on local disk
+// or behind a CDN. Selection happens once at startup via newStorage, based
+// on cfg.Storage.Backend.
+type Storage interface {
+	// Put stores the contents of r under key and returns the URL clients
+	// should use to fetch it.
+	Put(ctx context.Context, key, contentType string, r io.Reader) (publicURL string, err error)
+	// Delete removes the object stored under key. Deleting a key that
+	// doesn't exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// newStorage builds the Storage backend selected by cfg.Storage.Backend.
+// cfg.validate has already rejected an unknown backend or missing
+// credentials by the time this is called.
+func newStorage(cfg *Config) (Storage, error) {
+	switch cfg.Storage.Backend {
+	case "local":
+		return &LocalStorage{Dir: cfg.Storage.Local.Dir, PublicBase: "/static/uploads"}, nil
+	case "bunny":
+		return &BunnyStorage{
+			StorageEndpoint: cfg.Storage.Bunny.StorageEndpoint,
+			CDNBaseURL:      cfg.Storage.Bunny.CDNBaseURL,
+			AccessKey:       cfg.Storage.Bunny.AccessKey,
+		}, nil
+	case "s3":
+		return nil, fmt.Errorf("storage backend %q is not implemented yet", cfg.Storage.Backend)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+// LocalStorage persists uploads under a directory on local disk, served back
+// out by router.Static("/static", ...) in main. It's the default and
+// requires no configuration.
+type LocalStorage struct {
+	Dir        string // e.g. "static/uploads"
+	PublicBase string // e.g. "/static/uploads"
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key, contentType string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("mkdir %s: %w", s.Dir, err)
+	}
+
+	dst := filepath.Join(s.Dir, key)
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", fmt.Errorf("create %s: %w", dst, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return "", fmt.Errorf("write %s: %w", dst, err)
+	}
+
+	return path.Join(s.PublicBase, key), nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(filepath.Join(s.Dir, key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// BunnyStorage uploads to a Bunny.net storage zone over HTTP PUT and serves
+// reads from that zone's pull-zone CDN URL. See
+// https://docs.bunny.net/reference/storage-api.
+type BunnyStorage struct {
+	StorageEndpoint string // e.g. "https://storage.bunnycdn.com/platify"
+	CDNBaseURL      string // e.g. "https://platify.b-cdn.net"
+	AccessKey       string
+	Client          *http.Client
+}
+
+func (s *BunnyStorage) Put(ctx context.Context, key, contentType string, r io.Reader) (string, error) {
+	url := strings.TrimRight(s.StorageEndpoint, "/") + "/" + key
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, r)
+	if err != nil {
+		return "", fmt.Errorf("building bunny request: %w", err)
+	}
+	req.Header.Set("AccessKey", s.AccessKey)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return "", &storageUnavailableError{backend: "bunny", err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return "", &storageUnavailableError{backend: "bunny", err: fmt.Errorf("upload returned %d: %s", resp.StatusCode, body)}
+	}
+
+	return strings.TrimRight(s.CDNBaseURL, "/") + "/" + key, nil
+}
+
+func (s *BunnyStorage) Delete(ctx context.Context, key string) error {
+	url := strings.TrimRight(s.StorageEndpoint, "/") + "/" + key
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return fmt.Errorf("building bunny request: %w", err)
+	}
+	req.Header.Set("AccessKey", s.AccessKey)
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return &storageUnavailableError{backend: "bunny", err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return &storageUnavailableError{backend: "bunny", err: fmt.Errorf("delete returned %d", resp.StatusCode)}
+	}
+	return nil
+}
+
+func (s *BunnyStorage) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+// storageUnavailableError marks a Storage failure as coming from a remote
+// backend, so handlers can surface it as 502/503 instead of a generic 500.
+type storageUnavailableError struct {
+	backend string
+	err     error
+}
+
+func (e *storageUnavailableError) Error() string {
+	return fmt.Sprintf("%s storage unavailable: %v", e.backend, e.err)
+}
+
+func (e *storageUnavailableError) Unwrap() error { return e.err }